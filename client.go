@@ -1,35 +1,98 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/textproto"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // FTP Statuses
 const (
-	noStatus                    = -1
-	statusSendData              = 150
-	statusSuccess               = 200
-	statusInformative           = 211
-	statusHelp                  = 214
-	statusEnterPassiveMode      = 221
-	statusDataConnectionClosing = 221
-	statusTransferComplete      = 226
-	statusLoggedIn              = 230
-	statusDeleteSuccess         = 250
-	statusDirectoryChange       = 250
-	statusDirectorySuccess      = 257
-	statusRequiresPassword      = 331
+	noStatus                      = -1
+	statusFileStatus              = 213
+	statusSendData                = 150
+	statusSuccess                 = 200
+	statusSyntaxError             = 500
+	statusCommandNotImplemented   = 502
+	statusInformative             = 211
+	statusHelp                    = 214
+	statusEnterPassiveMode        = 221
+	statusDataConnectionClosing   = 221
+	statusEnteringExtendedPassive = 229
+	statusTransferComplete        = 226
+	statusLoggedIn                = 230
+	statusAuthOk                  = 234
+	statusDeleteSuccess           = 250
+	statusDirectoryChange         = 250
+	statusDirectorySuccess        = 257
+	statusFileActionPending       = 350
+	statusRequiresPassword        = 331
 )
 
 // FtpClient is a client with which can talk to FTP servers.
 type FtpClient struct {
 	connection *textproto.Conn
+	conn       net.Conn
+	dialer     *net.Dialer
+	ctx        context.Context
+	timeout    time.Duration
+
+	tlsConfig     *tls.Config
+	implicitTLS   bool
+	explicitTLS   bool
+	dataProtected bool
+
+	disableEPSV bool
+
+	features map[string]bool
+}
+
+// DialOption configures how Connect dials the control connection and how
+// subsequent data connections are established.
+type DialOption func(*FtpClient)
+
+// WithTimeout sets the dial timeout for the control connection, and an
+// idle read/write timeout refreshed on every I/O on each data connection,
+// so that a hung server can't block a transfer forever without cutting
+// off a slow but otherwise healthy large transfer.
+func WithTimeout(timeout time.Duration) DialOption {
+	return func(c *FtpClient) {
+		c.timeout = timeout
+	}
+}
+
+// WithDialer supplies a *net.Dialer to use for the control connection and
+// every passive data connection, in place of the zero-value default.
+func WithDialer(dialer *net.Dialer) DialOption {
+	return func(c *FtpClient) {
+		c.dialer = dialer
+	}
+}
+
+// WithContext sets the context used to dial the control connection and
+// every passive data connection.  Cancelling it aborts any in-flight dial.
+func WithContext(ctx context.Context) DialOption {
+	return func(c *FtpClient) {
+		c.ctx = ctx
+	}
+}
+
+// WithDisableEPSV turns off the automatic EPSV/IPv6 negotiation added for
+// RFC 2428 support, for servers that mishandle the EPSV command.  The
+// client falls back to classic PASV for every transfer.
+func WithDisableEPSV() DialOption {
+	return func(c *FtpClient) {
+		c.disableEPSV = true
+	}
 }
 
 // FtpMode specifies if a connection should transfer data in ASCII, "text",
@@ -55,21 +118,53 @@ type passiveData struct {
 
 // Connect establishes an FTP connection to a server and returns an FtpClient.
 // Host can be in the form of "host" or "host:port".  Host can be either a
-// hostname or an IP address.
-func Connect(host, username, password string) (*FtpClient, string, error) {
+// hostname or an IP address.  Options can be passed to configure dial
+// timeouts, a custom *net.Dialer, or a cancellation context; see
+// WithTimeout, WithDialer and WithContext.
+func Connect(host, username, password string, opts ...DialOption) (*FtpClient, string, error) {
+	client := &FtpClient{}
+	for _, opt := range opts {
+		opt(client)
+	}
+	if client.dialer == nil {
+		client.dialer = &net.Dialer{}
+	}
+	if client.ctx == nil {
+		client.ctx = context.Background()
+	}
+	if client.timeout > 0 {
+		client.dialer.Timeout = client.timeout
+	}
+
 	// Establish a connection
-	connection, err := textproto.Dial("tcp", host)
+	conn, err := client.dialer.DialContext(client.ctx, "tcp", host)
 	if err != nil {
 		return nil, "", err
 	}
 
+	// For implicit FTPS, the control connection is TLS from the very first
+	// byte, before the server ever sends its banner.
+	if client.implicitTLS {
+		conn = tls.Client(conn, client.tlsConfig)
+		client.dataProtected = true
+	}
+	client.conn = conn
+	client.connection = textproto.NewConn(conn)
+
 	// Get the hello from the server
-	client := &FtpClient{connection}
 	code, message, err := client.helloFromServer()
 	if err != nil {
 		return nil, "", err
 	}
 
+	// For explicit FTPS, the control connection starts in the clear and is
+	// upgraded via AUTH TLS once the banner has been read.
+	if client.explicitTLS {
+		if err := client.authTLS(); err != nil {
+			return nil, message, err
+		}
+	}
+
 	// Authenticate with a username (may return early if password isn't needed)
 	code, err = client.User(username)
 	if err != nil && code != statusLoggedIn {
@@ -83,6 +178,12 @@ func Connect(host, username, password string) (*FtpClient, string, error) {
 		return nil, message, err
 	}
 
+	// FEAT is optional; servers that don't support it are left with no
+	// advertised features, and NameList falls back to parsing LIST output.
+	if features, err := client.probeFeatures(); err == nil {
+		client.features = features
+	}
+
 	return client, message, nil
 }
 
@@ -106,22 +207,31 @@ func (c *FtpClient) expectResponse(command string, expectCode int) (int, string,
 	defer c.connection.EndResponse(id)
 
 	// Read what the server sent
-	code, line, err := c.connection.ReadResponse(expectCode)
-	return code, line, nil
+	return c.connection.ReadResponse(expectCode)
 }
 
-// User authenticates an FtpClient with a particular username.
+// User authenticates an FtpClient with a particular username.  The server
+// normally replies with statusRequiresPassword, but some servers (e.g.
+// anonymous-only ones) log the user in without a password and reply with
+// statusLoggedIn directly; both are accepted here.  Connect sends PASS
+// after USER in either case.
 func (c *FtpClient) User(username string) (int, error) {
 	command := fmt.Sprintf("USER %s", username)
-	code, _, err := c.expectResponse(command, statusLoggedIn)
-	return code, err
+	code, message, err := c.expectResponse(command, noStatus)
+	if err != nil {
+		return code, err
+	}
+	if code != statusRequiresPassword && code != statusLoggedIn {
+		return code, fmt.Errorf("unexpected USER response: %d %s", code, message)
+	}
+	return code, nil
 }
 
 // Password authenticates an FtpClient with a password.  This must be preceeded
 // by the User method.
 func (c *FtpClient) Password(password string) (int, error) {
 	command := fmt.Sprintf("PASS %s", password)
-	code, _, err := c.expectResponse(command, statusRequiresPassword)
+	code, _, err := c.expectResponse(command, statusLoggedIn)
 	return code, err
 }
 
@@ -137,6 +247,13 @@ func (c *FtpClient) Stat() (string, error) {
 	return message, err
 }
 
+// Noop sends a no-op command to the server.  It has no effect beyond
+// checking that the control connection is still alive.
+func (c *FtpClient) Noop() error {
+	_, _, err := c.expectResponse("NOOP", statusSuccess)
+	return err
+}
+
 // Mode sets the particular data transfer mode, usually ASCII or BINARY.
 func (c *FtpClient) Mode(mode FtpMode) (string, error) {
 	command := fmt.Sprintf("TYPE %s", mode)
@@ -147,14 +264,14 @@ func (c *FtpClient) Mode(mode FtpMode) (string, error) {
 // List retrieves the contents of the current remote directory.
 func (c *FtpClient) List() (string, error) {
 	// List requires a data connection
-	host, err := c.passiveMode()
+	host, err := c.negotiatePassiveMode()
 	if err != nil {
 		return "", err
 	}
 
 	data := make(chan passiveData)
 	// Start the data connection
-	go passiveRead(host, data)
+	go c.passiveRead(host, data)
 
 	// Ensure the connection is successful
 	if message := <-data; message.err != nil {
@@ -183,82 +300,196 @@ func (c *FtpClient) List() (string, error) {
 	return message.data, nil
 }
 
-// Retrieve gets a remote file from the server.
-func (c *FtpClient) Retrieve(filename string) (string, error) {
-	// Retrieve requires passive data connection
-	host, err := c.passiveMode()
-	if err != nil {
-		return "", err
+// dataConnReader adapts an open passive data connection into an
+// io.ReadCloser.  Close shuts down the data connection and then reads the
+// final transfer-complete response off the control connection, the same
+// way jlaffaye/ftp's Response type does.  This lets callers stream a
+// transfer without ever buffering the whole file in memory.
+type dataConnReader struct {
+	conn   net.Conn
+	client *FtpClient
+	closed bool
+}
+
+func (r *dataConnReader) Read(p []byte) (int, error) {
+	return r.conn.Read(p)
+}
+
+func (r *dataConnReader) Close() error {
+	if r.closed {
+		return nil
 	}
+	r.closed = true
 
-	data := make(chan passiveData)
-	// Start the data connection
-	go passiveRead(host, data)
+	if err := r.conn.Close(); err != nil {
+		return err
+	}
+	_, _, err := r.client.connection.ReadResponse(statusTransferComplete)
+	return err
+}
 
-	// Ensure the connection is successful
-	if message := <-data; message.err != nil {
-		close(data)
-		return "", err
+// openDataConn requests a passive data connection from the server and
+// dials it, honoring the client's configured dialer, context and timeout.
+func (c *FtpClient) openDataConn() (net.Conn, error) {
+	host, err := c.negotiatePassiveMode()
+	if err != nil {
+		return nil, err
 	}
+	return c.dialData(host)
+}
 
-	// Ask for the file
-	command := fmt.Sprintf("RETR %s", filename)
-	_, _, err = c.expectResponse(command, statusEnterPassiveMode)
+// dialData dials a data connection host using the client's dialer and
+// context, applying the configured timeout as a per-I/O idle deadline so a
+// hung server can't block a transfer forever without killing a slow but
+// healthy multi-gigabyte transfer.
+func (c *FtpClient) dialData(host string) (net.Conn, error) {
+	dialer := c.dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", host)
 	if err != nil {
-		// Something went wrong; abort the data connection
-		data <- passiveData{"", err}
-		return "", err
+		return nil, err
 	}
 
-	// Tell the data connection it is clear to receive
-	data <- passiveData{"", nil}
+	var dataConn net.Conn = conn
+	if c.timeout > 0 {
+		dataConn = &deadlineConn{Conn: conn, timeout: c.timeout}
+	}
 
-	// Get the file
-	message := <-data
-	if _, _, err := c.connection.ReadResponse(statusTransferComplete); err != nil {
-		return "", err
+	// If the control connection negotiated PROT P (or this is implicit
+	// FTPS), the data connection must be TLS-wrapped too.  Reusing the same
+	// *tls.Config shares its ClientSessionCache, if it has one, with the
+	// control connection; no cache is added here, so without one every data
+	// connection makes a full TLS handshake.
+	if c.dataProtected {
+		tlsConn := tls.Client(dataConn, c.tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		dataConn = tlsConn
 	}
 
-	return message.data, nil
+	return dataConn, nil
 }
 
-// Store sends a file to be stored on the FTP server.
-func (c *FtpClient) Store(name string, contents []byte) (string, error) {
-	// Store requires passive data connection
-	host, err := c.passiveMode()
+// deadlineConn wraps a net.Conn and refreshes a read/write deadline before
+// every Read or Write, rather than imposing a single deadline for the
+// connection's entire lifetime.  That distinction matters for something
+// like RetrieveStream: a fixed deadline equal to a short dial timeout
+// would kill a large, slow-but-healthy transfer partway through, whereas
+// an idle deadline only fires when the server actually stops responding.
+type deadlineConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (d *deadlineConn) Read(p []byte) (int, error) {
+	if err := d.Conn.SetDeadline(time.Now().Add(d.timeout)); err != nil {
+		return 0, err
+	}
+	return d.Conn.Read(p)
+}
+
+func (d *deadlineConn) Write(p []byte) (int, error) {
+	if err := d.Conn.SetDeadline(time.Now().Add(d.timeout)); err != nil {
+		return 0, err
+	}
+	return d.Conn.Write(p)
+}
+
+// openDataConnForCommand opens a data connection, optionally seeks to
+// offset with REST, then sends command (e.g. "RETR name") and returns the
+// data connection for the caller to read or write.  offset of 0 skips
+// REST entirely, since not all servers support it.
+func (c *FtpClient) openDataConnForCommand(command string, offset uint64) (net.Conn, error) {
+	conn, err := c.openDataConn()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	data := make(chan passiveData)
-	// Start the data connection
-	go passiveWrite(host, data, contents)
+	if offset > 0 {
+		if err := c.restartAt(offset); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
 
-	// Ensure the connection is successful
-	if message := <-data; message.err != nil {
-		close(data)
-		return "", err
+	if _, _, err := c.expectResponse(command, statusEnterPassiveMode); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// writeDataConn streams r to conn, an already-opened data connection, then
+// closes it and reads the final transfer-complete response.
+func (c *FtpClient) writeDataConn(conn net.Conn, r io.Reader) error {
+	if _, err := io.Copy(conn, r); err != nil {
+		conn.Close()
+		return err
+	}
+	if err := conn.Close(); err != nil {
+		return err
 	}
 
-	// Tell the server to prepare to receive a file
+	_, _, err := c.connection.ReadResponse(statusTransferComplete)
+	return err
+}
+
+// RetrieveStream gets a remote file from the server without buffering it
+// in memory.  The returned io.ReadCloser streams the file as it arrives;
+// the caller must Close it, which also waits for the server to confirm
+// the transfer completed.
+func (c *FtpClient) RetrieveStream(filename string) (io.ReadCloser, error) {
+	command := fmt.Sprintf("RETR %s", filename)
+	conn, err := c.openDataConnForCommand(command, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &dataConnReader{conn: conn, client: c}, nil
+}
+
+// StoreStream sends the contents of r to be stored on the FTP server as
+// name, streaming it over the data connection rather than buffering it in
+// memory first.
+func (c *FtpClient) StoreStream(name string, r io.Reader) error {
 	command := fmt.Sprintf("STOR %s", name)
-	_, _, err = c.expectResponse(command, statusEnterPassiveMode)
+	conn, err := c.openDataConnForCommand(command, 0)
 	if err != nil {
-		// Something went wrong; abort the data connection
-		data <- passiveData{"", err}
-		return "", err
+		return err
 	}
+	return c.writeDataConn(conn, r)
+}
 
-	// Tell the data connection it is clear to send
-	data <- passiveData{"", nil}
+// Retrieve gets a remote file from the server.
+func (c *FtpClient) Retrieve(filename string) (string, error) {
+	r, err := c.RetrieveStream(filename)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
 
-	// Send the file
-	message := <-data
-	if _, _, err := c.connection.ReadResponse(statusTransferComplete); err != nil {
+	contents, err := ioutil.ReadAll(r)
+	if err != nil {
 		return "", err
 	}
+	return string(contents), nil
+}
 
-	return message.data, nil
+// Store sends a file to be stored on the FTP server.
+func (c *FtpClient) Store(name string, contents []byte) (string, error) {
+	if err := c.StoreStream(name, bytes.NewReader(contents)); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Bytes sent: %d", len(contents)), nil
 }
 
 // Delete deletes a file from the FTP server.
@@ -357,9 +588,9 @@ func (c *FtpClient) passiveMode() (string, error) {
 
 // passiveConnection establishes a secondary connection with the FTP server to
 // send data across.  This is meant to be run as a goroutine.
-func passiveConnection(host string, data chan passiveData) (net.Conn, error) {
+func (c *FtpClient) passiveConnection(host string, data chan passiveData) (net.Conn, error) {
 	// Establish the data connection
-	conn, err := net.Dial("tcp", host)
+	conn, err := c.dialData(host)
 	if err != nil {
 		// Something went wrong; abort
 		data <- passiveData{"", err}
@@ -383,9 +614,9 @@ func passiveConnection(host string, data chan passiveData) (net.Conn, error) {
 
 // passiveRead reads all data sent by the FTP server via passive data
 // connection
-func passiveRead(host string, data chan passiveData) {
+func (c *FtpClient) passiveRead(host string, data chan passiveData) {
 	// Establish connection
-	conn, err := passiveConnection(host, data)
+	conn, err := c.passiveConnection(host, data)
 	if err != nil {
 		return
 	}
@@ -403,25 +634,3 @@ func passiveRead(host string, data chan passiveData) {
 	data <- passiveData{string(bytes), nil}
 	close(data)
 }
-
-// passiveWrite writes contents in its entirety to the FTP server via passive
-// data connection
-func passiveWrite(host string, data chan passiveData, contents []byte) {
-	// Establish connection
-	conn, err := passiveConnection(host, data)
-	if err != nil {
-		return
-	}
-
-	// Write bytes to server
-	n, err := conn.Write(contents)
-	if err != nil {
-		data <- passiveData{"", err}
-	}
-	conn.Close()
-
-	// Return to main routine success
-	message := fmt.Sprintf("Bytes sent: %d", n)
-	data <- passiveData{message, nil}
-	close(data)
-}
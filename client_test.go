@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeServer is a minimal stand-in for an FTP control connection, used by
+// tests to script one command/response exchange at a time without a real
+// FTP server.  Its methods return an error instead of failing the test
+// directly, since they're meant to be driven from a goroutine and
+// t.Fatal/FailNow are only safe to call from the test's own goroutine.
+type fakeServer struct {
+	netConn net.Conn
+	conn    *textproto.Conn
+}
+
+// upgrade replaces the connection fakeServer reads/writes on, e.g. after a
+// TLS handshake, so subsequent expectCommand/reply calls go over it.
+func (s *fakeServer) upgrade(conn net.Conn) {
+	s.netConn = conn
+	s.conn = textproto.NewConn(conn)
+}
+
+func (s *fakeServer) expectCommand(want string) error {
+	line, err := s.conn.ReadLine()
+	if err != nil {
+		return fmt.Errorf("reading command: %w", err)
+	}
+	if line != want {
+		return fmt.Errorf("got command %q, want %q", line, want)
+	}
+	return nil
+}
+
+func (s *fakeServer) reply(code int, message string) error {
+	return s.conn.PrintfLine("%d %s", code, message)
+}
+
+// newTestClient wires an FtpClient's control connection to an in-process
+// fakeServer over a net.Pipe, so tests can script server responses without
+// dialing a real FTP server.
+func newTestClient(t *testing.T) (*FtpClient, *fakeServer) {
+	t.Helper()
+	clientConn, serverConn := net.Pipe()
+	t.Cleanup(func() {
+		clientConn.Close()
+		serverConn.Close()
+	})
+
+	client := &FtpClient{
+		conn:        clientConn,
+		connection:  textproto.NewConn(clientConn),
+		dialer:      &net.Dialer{},
+		ctx:         context.Background(),
+		disableEPSV: true,
+	}
+	return client, &fakeServer{netConn: serverConn, conn: textproto.NewConn(serverConn)}
+}
+
+// newFakeDataListener starts a loopback TCP listener for tests that need a
+// real data connection: dialData always dials "tcp", regardless of the
+// in-process net.Pipe used for the control connection.
+func newFakeDataListener(t *testing.T) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening for fake data connection: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	return ln
+}
+
+// pasvReplyFor formats a PASV success reply advertising ln's address, in
+// the same "(h1,h2,h3,h4,p1,p2)" form passiveResponseToHost parses.
+func pasvReplyFor(t *testing.T, ln net.Listener) string {
+	t.Helper()
+	_, portStr, err := net.SplitHostPort(ln.Addr().String())
+	if err != nil {
+		t.Fatalf("splitting listener address: %v", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatalf("parsing listener port: %v", err)
+	}
+	return fmt.Sprintf("Entering Passive Mode (127,0,0,1,%d,%d).", port>>8, port&0xff)
+}
+
+func TestExpectResponsePropagatesError(t *testing.T) {
+	client, server := newTestClient(t)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- func() error {
+			if err := server.expectCommand("NOOP"); err != nil {
+				return err
+			}
+			return server.reply(statusCommandNotImplemented, "Command not implemented")
+		}()
+	}()
+
+	err := client.Noop()
+	if err == nil {
+		t.Fatal("Noop() = nil, want an error for a 502 response")
+	}
+	if ftpErr, ok := err.(*textproto.Error); !ok || ftpErr.Code != statusCommandNotImplemented {
+		t.Errorf("Noop() error = %v, want *textproto.Error{Code: %d, ...}", err, statusCommandNotImplemented)
+	}
+
+	if err := <-errc; err != nil {
+		t.Fatalf("fake server: %v", err)
+	}
+}
+
+func TestRetrieveStreamSurfacesTransferError(t *testing.T) {
+	client, server := newTestClient(t)
+	ln := newFakeDataListener(t)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- func() error {
+			if err := server.expectCommand("PASV"); err != nil {
+				return err
+			}
+			if err := server.reply(statusEnterPassiveMode, pasvReplyFor(t, ln)); err != nil {
+				return err
+			}
+
+			conn, err := ln.Accept()
+			if err != nil {
+				return fmt.Errorf("accepting data connection: %w", err)
+			}
+			defer conn.Close()
+
+			if err := server.expectCommand("RETR missing.txt"); err != nil {
+				return err
+			}
+			// The server refuses the transfer; RetrieveStream must surface
+			// this instead of handing back a reader for an empty file.
+			return server.reply(550, "No such file or directory")
+		}()
+	}()
+
+	_, err := client.RetrieveStream("missing.txt")
+	if err == nil {
+		t.Fatal("RetrieveStream() = nil error, want an error for a refused RETR")
+	}
+
+	if err := <-errc; err != nil {
+		t.Fatalf("fake server: %v", err)
+	}
+}
+
+func TestStoreStreamSurfacesTransferError(t *testing.T) {
+	client, server := newTestClient(t)
+	ln := newFakeDataListener(t)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- func() error {
+			if err := server.expectCommand("PASV"); err != nil {
+				return err
+			}
+			if err := server.reply(statusEnterPassiveMode, pasvReplyFor(t, ln)); err != nil {
+				return err
+			}
+
+			conn, err := ln.Accept()
+			if err != nil {
+				return fmt.Errorf("accepting data connection: %w", err)
+			}
+			defer conn.Close()
+
+			if err := server.expectCommand("STOR readonly.txt"); err != nil {
+				return err
+			}
+			return server.reply(550, "Permission denied")
+		}()
+	}()
+
+	err := client.StoreStream("readonly.txt", strings.NewReader("payload"))
+	if err == nil {
+		t.Fatal("StoreStream() = nil, want an error for a refused STOR")
+	}
+
+	if err := <-errc; err != nil {
+		t.Fatalf("fake server: %v", err)
+	}
+}
+
+func TestDeadlineConnRefreshesPerIO(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	// A fixed deadline set once, equal to this timeout, would expire well
+	// before the 5*20ms below elapses.  deadlineConn must refresh it on
+	// every Read instead, so a slow-but-steady peer is never cut off.
+	dc := &deadlineConn{Conn: clientConn, timeout: 50 * time.Millisecond}
+
+	go func() {
+		for i := 0; i < 5; i++ {
+			time.Sleep(20 * time.Millisecond)
+			serverConn.Write([]byte("x"))
+		}
+	}()
+
+	buf := make([]byte, 1)
+	for i := 0; i < 5; i++ {
+		if _, err := dc.Read(buf); err != nil {
+			t.Fatalf("Read %d: %v", i, err)
+		}
+	}
+}
+
+func TestDeadlineConnTimesOutWhenIdle(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	dc := &deadlineConn{Conn: clientConn, timeout: 20 * time.Millisecond}
+
+	buf := make([]byte, 1)
+	_, err := dc.Read(buf)
+	if err == nil {
+		t.Fatal("Read() = nil error, want a deadline-exceeded error since the peer never writes")
+	}
+	if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+		t.Fatalf("Read() error = %v, want a net.Error reporting Timeout()", err)
+	}
+}
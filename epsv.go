@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+)
+
+// epsvResponseRegexp pulls the port out of an RFC 2428 EPSV response, as in
+// "229 Entering Extended Passive Mode (|||6446|)."
+var epsvResponseRegexp = regexp.MustCompile(`\(\|\|\|(\d+)\|\)`)
+
+// epsvResponseToPort parses the port number out of an EPSV response.
+func epsvResponseToPort(response string) (int, error) {
+	matches := epsvResponseRegexp.FindStringSubmatch(response)
+	if matches == nil {
+		return 0, fmt.Errorf("could not parse EPSV response: %q", response)
+	}
+	return strconv.Atoi(matches[1])
+}
+
+// negotiatePassiveMode asks the server to open a data connection for the
+// next transfer.  It prefers EPSV (RFC 2428), which works over both IPv4
+// and IPv6, and falls back to classic PASV when the server doesn't
+// understand EPSV or a caller has opted out via WithDisableEPSV.
+func (c *FtpClient) negotiatePassiveMode() (string, error) {
+	if c.disableEPSV {
+		return c.passiveMode()
+	}
+
+	code, host, err := c.epsvMode()
+	if err == nil {
+		return host, nil
+	}
+	if shouldFallbackToPASV(code) {
+		return c.passiveMode()
+	}
+	return "", err
+}
+
+// shouldFallbackToPASV reports whether an EPSV response code means the
+// server doesn't understand EPSV and PASV should be tried instead, rather
+// than some other failure that PASV would hit too.
+func shouldFallbackToPASV(code int) bool {
+	return code == statusSyntaxError || code == statusCommandNotImplemented
+}
+
+// epsvMode requests an extended passive (EPSV) data connection, per
+// RFC 2428, and returns a host:port reusing the control connection's
+// remote IP address, so it works for IPv6 servers as well as IPv4.
+func (c *FtpClient) epsvMode() (int, string, error) {
+	code, message, err := c.expectResponse("EPSV", statusEnteringExtendedPassive)
+	if err != nil {
+		return code, "", err
+	}
+	if code != statusEnteringExtendedPassive {
+		return code, "", fmt.Errorf("unexpected EPSV response: %d %s", code, message)
+	}
+
+	port, err := epsvResponseToPort(message)
+	if err != nil {
+		return code, "", err
+	}
+
+	host, _, err := net.SplitHostPort(c.conn.RemoteAddr().String())
+	if err != nil {
+		return code, "", err
+	}
+
+	return code, net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import "testing"
+
+func TestEpsvResponseToPort(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     int
+		wantErr  bool
+	}{
+		{
+			name:     "typical response",
+			response: "229 Entering Extended Passive Mode (|||6446|).",
+			want:     6446,
+		},
+		{
+			name:     "low port number",
+			response: "229 Entering Extended Passive Mode (|||1|).",
+			want:     1,
+		},
+		{
+			name:     "missing delimiters",
+			response: "229 Entering Extended Passive Mode (6446).",
+			wantErr:  true,
+		},
+		{
+			name:     "empty response",
+			response: "",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := epsvResponseToPort(tt.response)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("epsvResponseToPort(%q) = %d, nil; want error", tt.response, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("epsvResponseToPort(%q) returned unexpected error: %v", tt.response, err)
+			}
+			if got != tt.want {
+				t.Errorf("epsvResponseToPort(%q) = %d, want %d", tt.response, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPassiveResponseToHost(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "typical response",
+			response: "227 Entering Passive Mode (192,168,1,6,82,110).",
+			want:     "192.168.1.6:21102",
+		},
+		{
+			name:     "zero upper port byte",
+			response: "227 Entering Passive Mode (10,0,0,1,0,21).",
+			want:     "10.0.0.1:21",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := passiveResponseToHost(tt.response)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("passiveResponseToHost(%q) = %q, nil; want error", tt.response, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("passiveResponseToHost(%q) returned unexpected error: %v", tt.response, err)
+			}
+			if got != tt.want {
+				t.Errorf("passiveResponseToHost(%q) = %q, want %q", tt.response, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShouldFallbackToPASV(t *testing.T) {
+	tests := []struct {
+		name string
+		code int
+		want bool
+	}{
+		{name: "syntax error falls back", code: statusSyntaxError, want: true},
+		{name: "command not implemented falls back", code: statusCommandNotImplemented, want: true},
+		{name: "success does not fall back", code: statusEnteringExtendedPassive, want: false},
+		{name: "unrelated error does not fall back", code: 421, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shouldFallbackToPASV(tt.code); got != tt.want {
+				t.Errorf("shouldFallbackToPASV(%d) = %v, want %v", tt.code, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EntryType identifies what kind of thing a directory Entry describes.
+type EntryType int
+
+// The entry types defined by RFC 3659's MLST "type" fact, plus Link for
+// symlinks recognized while parsing classic LIST output.
+const (
+	EntryTypeUnknown EntryType = iota
+	EntryTypeFile
+	EntryTypeDir
+	// EntryTypeCDir marks the listed directory itself (MLST "type=cdir").
+	EntryTypeCDir
+	// EntryTypePDir marks the parent directory (MLST "type=pdir").
+	EntryTypePDir
+	EntryTypeLink
+)
+
+// Entry describes one item returned by NameList.
+type Entry struct {
+	Name   string
+	Type   EntryType
+	Size   uint64
+	Time   time.Time
+	Target string
+}
+
+// probeFeatures asks the server which optional commands it supports via
+// FEAT (RFC 2389) and returns the advertised feature names, upper-cased.
+func (c *FtpClient) probeFeatures() (map[string]bool, error) {
+	_, message, err := c.expectResponse("FEAT", statusInformative)
+	if err != nil {
+		return nil, err
+	}
+
+	features := make(map[string]bool)
+	for _, line := range strings.Split(message, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, strconv.Itoa(statusInformative)) {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		features[strings.ToUpper(fields[0])] = true
+	}
+	return features, nil
+}
+
+// NameList retrieves the contents of a remote directory as structured
+// Entry values.  When the server advertises MLSD (RFC 3659), the
+// machine-readable listing is used; otherwise NameList falls back to
+// parsing common LIST output styles (Unix "ls -l" and Windows DOS).
+func (c *FtpClient) NameList(path string) ([]*Entry, error) {
+	if useMLSD(c.features) {
+		return c.mlsd(path)
+	}
+	return c.listFallback(path)
+}
+
+// useMLSD reports whether NameList should use MLSD rather than falling
+// back to classic LIST parsing, based on the features advertised by FEAT.
+func useMLSD(features map[string]bool) bool {
+	return features["MLSD"]
+}
+
+// mlsd fetches and parses a machine-readable directory listing.
+func (c *FtpClient) mlsd(path string) ([]*Entry, error) {
+	raw, err := c.fetchListing("MLSD", path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*Entry
+	for _, line := range strings.Split(raw, "\r\n") {
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			continue
+		}
+		if entry := parseMLSTLine(line); entry != nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// listFallback fetches a classic LIST listing and parses whichever of the
+// supported styles matches each line.
+func (c *FtpClient) listFallback(path string) ([]*Entry, error) {
+	raw, err := c.fetchListing("LIST", path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*Entry
+	for _, line := range strings.Split(raw, "\r\n") {
+		line = strings.TrimRight(line, "\r\n")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if entry := parseUnixListLine(line); entry != nil {
+			entries = append(entries, entry)
+			continue
+		}
+		if entry := parseDOSListLine(line); entry != nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// fetchListing opens a data connection, issues command (MLSD or LIST),
+// optionally scoped to path, and reads the full listing off it.
+func (c *FtpClient) fetchListing(command, path string) (string, error) {
+	conn, err := c.openDataConn()
+	if err != nil {
+		return "", err
+	}
+
+	ftpCommand := strings.TrimSpace(fmt.Sprintf("%s %s", command, path))
+	if _, _, err := c.expectResponse(ftpCommand, statusEnterPassiveMode); err != nil {
+		conn.Close()
+		return "", err
+	}
+
+	raw, err := ioutil.ReadAll(conn)
+	conn.Close()
+	if err != nil {
+		return "", err
+	}
+
+	if _, _, err := c.connection.ReadResponse(statusTransferComplete); err != nil {
+		return "", err
+	}
+
+	return string(raw), nil
+}
+
+// parseMLSTLine parses a single RFC 3659 MLST/MLSD fact line, in the form
+// "fact=value;fact=value;... filename".
+func parseMLSTLine(line string) *Entry {
+	idx := strings.Index(line, " ")
+	if idx < 0 {
+		return nil
+	}
+
+	entry := &Entry{Name: line[idx+1:]}
+	for _, fact := range strings.Split(line[:idx], ";") {
+		if fact == "" {
+			continue
+		}
+		kv := strings.SplitN(fact, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		switch strings.ToLower(kv[0]) {
+		case "type":
+			entry.Type = parseMLSTType(kv[1])
+		case "size":
+			if size, err := strconv.ParseUint(kv[1], 10, 64); err == nil {
+				entry.Size = size
+			}
+		case "modify":
+			if t, err := time.Parse("20060102150405", kv[1]); err == nil {
+				entry.Time = t.UTC()
+			}
+		case "target":
+			entry.Target = kv[1]
+		}
+	}
+	return entry
+}
+
+func parseMLSTType(value string) EntryType {
+	switch strings.ToLower(value) {
+	case "file":
+		return EntryTypeFile
+	case "dir":
+		return EntryTypeDir
+	case "cdir":
+		return EntryTypeCDir
+	case "pdir":
+		return EntryTypePDir
+	default:
+		return EntryTypeUnknown
+	}
+}
+
+// unixListRegexp matches the common "ls -l" style LIST line, e.g.
+// "drwxr-xr-x  2 user group  4096 Jan 15 12:34 name" or, for older files,
+// "... Jan 15  2020 name".
+var unixListRegexp = regexp.MustCompile(`^([\-dl])\S*\s+\d+\s+\S+\s+\S+\s+(\d+)\s+(\w{3}\s+\d{1,2}\s+(?:\d{4}|\d{2}:\d{2}))\s+(.+)$`)
+
+func parseUnixListLine(line string) *Entry {
+	matches := unixListRegexp.FindStringSubmatch(line)
+	if matches == nil {
+		return nil
+	}
+
+	entry := &Entry{Name: matches[4]}
+	switch matches[1] {
+	case "d":
+		entry.Type = EntryTypeDir
+	case "l":
+		entry.Type = EntryTypeLink
+	default:
+		entry.Type = EntryTypeFile
+	}
+
+	if size, err := strconv.ParseUint(matches[2], 10, 64); err == nil {
+		entry.Size = size
+	}
+
+	if t, err := time.Parse("Jan 2 2006", matches[3]); err == nil {
+		entry.Time = t
+	} else if t, err := time.Parse("Jan 2 15:04", matches[3]); err == nil {
+		entry.Time = t
+	}
+
+	if entry.Type == EntryTypeLink {
+		if idx := strings.Index(entry.Name, " -> "); idx >= 0 {
+			entry.Target = entry.Name[idx+len(" -> "):]
+			entry.Name = entry.Name[:idx]
+		}
+	}
+
+	return entry
+}
+
+// dosListRegexp matches a Windows FTP server's DOS-style LIST line, e.g.
+// "10-23-17  03:55PM       <DIR>          folder" or
+// "10-23-17  03:55PM             1024 file.txt".
+var dosListRegexp = regexp.MustCompile(`^(\d{2}-\d{2}-\d{2,4})\s+(\d{2}:\d{2}(?:AM|PM))\s+(<DIR>|\d+)\s+(.+)$`)
+
+func parseDOSListLine(line string) *Entry {
+	matches := dosListRegexp.FindStringSubmatch(line)
+	if matches == nil {
+		return nil
+	}
+
+	entry := &Entry{Name: matches[4]}
+	if matches[3] == "<DIR>" {
+		entry.Type = EntryTypeDir
+	} else {
+		entry.Type = EntryTypeFile
+		if size, err := strconv.ParseUint(matches[3], 10, 64); err == nil {
+			entry.Size = size
+		}
+	}
+
+	if t, err := time.Parse("01-02-06 03:04PM", matches[1]+" "+matches[2]); err == nil {
+		entry.Time = t
+	}
+
+	return entry
+}
+
+// Size returns the size, in bytes, of a remote file via the SIZE command.
+func (c *FtpClient) Size(path string) (uint64, error) {
+	command := fmt.Sprintf("SIZE %s", path)
+	_, message, err := c.expectResponse(command, statusFileStatus)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(message), 10, 64)
+}
+
+// ModTime returns the last modification time of a remote file via MDTM, in
+// UTC.
+func (c *FtpClient) ModTime(path string) (time.Time, error) {
+	command := fmt.Sprintf("MDTM %s", path)
+	_, message, err := c.expectResponse(command, statusFileStatus)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	t, err := time.Parse("20060102150405", strings.TrimSpace(message))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.UTC(), nil
+}
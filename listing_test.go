@@ -0,0 +1,212 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseMLSTLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want *Entry
+	}{
+		{
+			name: "file",
+			line: "type=file;size=1024;modify=20230115123456; report.txt",
+			want: &Entry{
+				Name: "report.txt",
+				Type: EntryTypeFile,
+				Size: 1024,
+				Time: time.Date(2023, 1, 15, 12, 34, 56, 0, time.UTC),
+			},
+		},
+		{
+			name: "fractional seconds in modify fact",
+			line: "type=file;size=1;modify=20230115123456.789; x",
+			want: &Entry{
+				Name: "x",
+				Type: EntryTypeFile,
+				Size: 1,
+				Time: time.Date(2023, 1, 15, 12, 34, 56, 789000000, time.UTC),
+			},
+		},
+		{
+			name: "current directory",
+			line: "type=cdir;perm=el; .",
+			want: &Entry{Name: ".", Type: EntryTypeCDir},
+		},
+		{
+			name: "parent directory",
+			line: "type=pdir;perm=el; ..",
+			want: &Entry{Name: "..", Type: EntryTypePDir},
+		},
+		{
+			name: "symlink with target",
+			line: "type=OS.unix=symlink;target=/real/path; link.txt",
+			want: &Entry{Name: "link.txt", Type: EntryTypeUnknown, Target: "/real/path"},
+		},
+		{
+			name: "unrecognized fact is ignored",
+			line: "type=dir;bogus=whatever; subdir",
+			want: &Entry{Name: "subdir", Type: EntryTypeDir},
+		},
+		{
+			name: "no space separator returns nil",
+			line: "type=file;size=1024",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseMLSTLine(tt.line)
+			assertEntryEqual(t, got, tt.want)
+		})
+	}
+}
+
+func TestParseUnixListLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want *Entry
+	}{
+		{
+			name: "directory with time-of-day timestamp",
+			line: "drwxr-xr-x  2 user group  4096 Jan 15 12:34 subdir",
+			want: &Entry{
+				Name: "subdir",
+				Type: EntryTypeDir,
+				Size: 4096,
+				Time: time.Date(0, time.January, 15, 12, 34, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "file with year timestamp",
+			line: "-rw-r--r--  1 user group  123 Jan 15  2020 report.txt",
+			want: &Entry{
+				Name: "report.txt",
+				Type: EntryTypeFile,
+				Size: 123,
+				Time: time.Date(2020, time.January, 15, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "symlink splits name and target",
+			line: "lrwxrwxrwx  1 user group  7 Jan 15 12:34 link -> target.txt",
+			want: &Entry{
+				Name:   "link",
+				Type:   EntryTypeLink,
+				Size:   7,
+				Time:   time.Date(0, time.January, 15, 12, 34, 0, 0, time.UTC),
+				Target: "target.txt",
+			},
+		},
+		{
+			name: "dot parses as an ordinary directory entry",
+			line: "drwxr-xr-x  3 user group  4096 Jan 15 12:34 .",
+			want: &Entry{
+				Name: ".",
+				Type: EntryTypeDir,
+				Size: 4096,
+				Time: time.Date(0, time.January, 15, 12, 34, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "non-matching line returns nil",
+			line: "total 8",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseUnixListLine(tt.line)
+			assertEntryEqual(t, got, tt.want)
+		})
+	}
+}
+
+func TestParseDOSListLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want *Entry
+	}{
+		{
+			name: "directory",
+			line: "10-23-17  03:55PM       <DIR>          folder",
+			want: &Entry{
+				Name: "folder",
+				Type: EntryTypeDir,
+				Time: time.Date(2017, time.October, 23, 15, 55, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "file with two-digit year",
+			line: "10-23-17  03:55PM             1024 file.txt",
+			want: &Entry{
+				Name: "file.txt",
+				Type: EntryTypeFile,
+				Size: 1024,
+				Time: time.Date(2017, time.October, 23, 15, 55, 0, 0, time.UTC),
+			},
+		},
+		{
+			name: "four-digit year is not parsed as a timestamp",
+			line: "10-23-2017  03:55PM             1024 file.txt",
+			want: &Entry{
+				Name: "file.txt",
+				Type: EntryTypeFile,
+				Size: 1024,
+			},
+		},
+		{
+			name: "non-matching line returns nil",
+			line: "not a dos listing line",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseDOSListLine(tt.line)
+			assertEntryEqual(t, got, tt.want)
+		})
+	}
+}
+
+func TestUseMLSD(t *testing.T) {
+	tests := []struct {
+		name     string
+		features map[string]bool
+		want     bool
+	}{
+		{name: "MLSD advertised", features: map[string]bool{"MLSD": true}, want: true},
+		{name: "MLSD not advertised", features: map[string]bool{"SIZE": true}, want: false},
+		{name: "no features probed", features: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := useMLSD(tt.features); got != tt.want {
+				t.Errorf("useMLSD(%v) = %v, want %v", tt.features, got, tt.want)
+			}
+		})
+	}
+}
+
+func assertEntryEqual(t *testing.T, got, want *Entry) {
+	t.Helper()
+	if (got == nil) != (want == nil) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	if got == nil {
+		return
+	}
+	if got.Name != want.Name || got.Type != want.Type || got.Size != want.Size ||
+		!got.Time.Equal(want.Time) || got.Target != want.Target {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxConns     = 4
+	defaultMaxIdle      = 5 * time.Minute
+	defaultNoopInterval = 30 * time.Second
+)
+
+// errPoolClosed is returned by Get once the Pool has been closed.
+var errPoolClosed = errors.New("ftpclient: pool is closed")
+
+// Pool maintains a bounded set of authenticated *FtpClient connections so
+// several transfers can run concurrently without re-authenticating for
+// each one; a single control connection can only drive one in-flight
+// data transfer at a time.  Idle connections are health-checked with a
+// periodic NOOP and replaced if they fail it or sit idle past MaxIdle.
+type Pool struct {
+	dial     func() (*FtpClient, error)
+	maxConns int
+	maxIdle  time.Duration
+
+	mu       sync.Mutex
+	conns    chan *FtpClient
+	lastUsed map[*FtpClient]time.Time
+	numOpen  int
+	closed   bool
+
+	stopKeepAlive chan struct{}
+}
+
+// PoolOption configures a Pool created with NewPool.
+type PoolOption func(*Pool)
+
+// WithMaxConns caps the number of connections the Pool will have open at
+// once, whether idle or checked out.  Defaults to 4.
+func WithMaxConns(n int) PoolOption {
+	return func(p *Pool) {
+		p.maxConns = n
+	}
+}
+
+// WithMaxIdle sets how long a connection may sit idle in the Pool before
+// the keepalive goroutine closes it; a later Get dials a replacement.
+// Defaults to 5 minutes.
+func WithMaxIdle(d time.Duration) PoolOption {
+	return func(p *Pool) {
+		p.maxIdle = d
+	}
+}
+
+// NewPool creates a Pool that dials new, authenticated connections with
+// dial (typically a closure over Connect and its credentials).
+func NewPool(dial func() (*FtpClient, error), opts ...PoolOption) *Pool {
+	p := &Pool{
+		dial:          dial,
+		maxConns:      defaultMaxConns,
+		maxIdle:       defaultMaxIdle,
+		lastUsed:      make(map[*FtpClient]time.Time),
+		stopKeepAlive: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	p.conns = make(chan *FtpClient, p.maxConns)
+
+	go p.keepAlive()
+	return p
+}
+
+// Get returns a connection from the Pool, reusing an idle one if available
+// or dialing a new one if fewer than MaxConns are currently open.  It
+// blocks until a connection is available or ctx is done.
+func (p *Pool) Get(ctx context.Context) (*FtpClient, error) {
+	for {
+		select {
+		case client, ok := <-p.conns:
+			if !ok {
+				return nil, errPoolClosed
+			}
+			return client, nil
+		default:
+		}
+
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, errPoolClosed
+		}
+		if p.numOpen < p.maxConns {
+			p.numOpen++
+			p.mu.Unlock()
+
+			client, err := p.dial()
+			if err != nil {
+				p.mu.Lock()
+				p.numOpen--
+				p.mu.Unlock()
+				return nil, err
+			}
+			return client, nil
+		}
+		p.mu.Unlock()
+
+		// Every connection is checked out; wait for one to be returned.
+		select {
+		case client, ok := <-p.conns:
+			if !ok {
+				return nil, errPoolClosed
+			}
+			return client, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Put returns client to the Pool for reuse.  Callers must not use client
+// again after calling Put.
+func (p *Pool) Put(client *FtpClient) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		client.Quit()
+		return
+	}
+	p.lastUsed[client] = time.Now()
+
+	// The send must happen in the same critical section as the p.closed
+	// check above: Close also closes p.conns under p.mu, and sending on a
+	// closed channel panics.  The channel is buffered to maxConns and
+	// every open connection is either checked out or sitting in it, so
+	// this send never blocks.
+	select {
+	case p.conns <- client:
+	default:
+		// Shouldn't happen, but don't leak the connection if our
+		// bookkeeping is ever off.
+		p.discardLocked(client)
+	}
+}
+
+// Close shuts down the Pool: it stops the keepalive goroutine and closes
+// every idle connection.  Connections currently checked out are closed
+// as they're returned via Put.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.stopKeepAlive)
+	close(p.conns)
+	p.mu.Unlock()
+
+	for client := range p.conns {
+		client.Quit()
+	}
+	return nil
+}
+
+// discard closes client and removes it from the Pool's open count, so a
+// subsequent Get can dial a replacement.
+func (p *Pool) discard(client *FtpClient) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.discardLocked(client)
+}
+
+// discardLocked is discard for callers that already hold p.mu.
+func (p *Pool) discardLocked(client *FtpClient) {
+	client.Quit()
+	delete(p.lastUsed, client)
+	p.numOpen--
+}
+
+// keepAlive periodically health-checks idle connections with NOOP,
+// closing and discarding those that fail it or have sat idle past
+// MaxIdle.
+func (p *Pool) keepAlive() {
+	ticker := time.NewTicker(defaultNoopInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stopKeepAlive:
+			return
+		case <-ticker.C:
+			p.healthCheckIdle()
+		}
+	}
+}
+
+// healthCheckIdle drains every connection currently idle in the Pool,
+// NOOPs each one, and either puts it back or discards it, leaving a later
+// Get to dial a replacement.
+func (p *Pool) healthCheckIdle() {
+	p.mu.Lock()
+	n := len(p.conns)
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		return
+	}
+
+	for i := 0; i < n; i++ {
+		var client *FtpClient
+		var ok bool
+		select {
+		case client, ok = <-p.conns:
+		default:
+			return
+		}
+		if !ok {
+			// Pool was closed while we were draining it.
+			return
+		}
+
+		p.mu.Lock()
+		lastUsed := p.lastUsed[client]
+		maxIdle := p.maxIdle
+		p.mu.Unlock()
+
+		if maxIdle > 0 && time.Since(lastUsed) > maxIdle {
+			p.discard(client)
+			continue
+		}
+
+		if err := client.Noop(); err != nil {
+			p.discard(client)
+			continue
+		}
+
+		// Re-check p.closed and send back in the same critical section:
+		// Close also closes p.conns under p.mu, and sending on a closed
+		// channel panics.
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			p.discard(client)
+			continue
+		}
+		select {
+		case p.conns <- client:
+			p.mu.Unlock()
+		default:
+			p.mu.Unlock()
+			p.discard(client)
+		}
+	}
+}
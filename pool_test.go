@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// loopServer answers every command line the client sends according to
+// reply, keyed by the command's verb (e.g. "NOOP").  It runs until the
+// connection is closed, which is how these tests shut a fake connection
+// down instead of scripting a QUIT exchange.
+func loopServer(server *fakeServer, reply map[string]func() (int, string)) {
+	go func() {
+		for {
+			line, err := server.conn.ReadLine()
+			if err != nil {
+				return
+			}
+			verb := line
+			if idx := strings.Index(line, " "); idx >= 0 {
+				verb = line[:idx]
+			}
+			handler, ok := reply[verb]
+			if !ok {
+				server.conn.PrintfLine("500 unknown command")
+				continue
+			}
+			code, msg := handler()
+			server.conn.PrintfLine("%d %s", code, msg)
+		}
+	}()
+}
+
+// healthyReplies answers NOOP and QUIT the way a live, well-behaved server
+// would.
+func healthyReplies() map[string]func() (int, string) {
+	return map[string]func() (int, string){
+		"NOOP": func() (int, string) { return statusSuccess, "ok" },
+		"QUIT": func() (int, string) { return statusInformative, "bye" },
+	}
+}
+
+// newPoolTestClient builds an FtpClient wired to an in-process fake server
+// that answers every command according to reply.
+func newPoolTestClient(t *testing.T, reply map[string]func() (int, string)) *FtpClient {
+	t.Helper()
+	client, server := newTestClient(t)
+	loopServer(server, reply)
+	return client
+}
+
+func TestHealthCheckIdleDiscardsOnFailedNoop(t *testing.T) {
+	healthy := newPoolTestClient(t, healthyReplies())
+	unhealthy := newPoolTestClient(t, map[string]func() (int, string){
+		"NOOP": func() (int, string) { return statusSyntaxError, "idle timeout" },
+		"QUIT": func() (int, string) { return statusInformative, "bye" },
+	})
+
+	p := &Pool{
+		maxConns: 2,
+		maxIdle:  time.Hour,
+		lastUsed: make(map[*FtpClient]time.Time),
+	}
+	p.conns = make(chan *FtpClient, p.maxConns)
+	p.conns <- healthy
+	p.conns <- unhealthy
+	p.lastUsed[healthy] = time.Now()
+	p.lastUsed[unhealthy] = time.Now()
+	p.numOpen = 2
+
+	p.healthCheckIdle()
+
+	if len(p.conns) != 1 {
+		t.Fatalf("len(p.conns) = %d, want 1 (only the healthy connection kept)", len(p.conns))
+	}
+	kept := <-p.conns
+	if kept != healthy {
+		t.Error("healthCheckIdle() discarded the healthy connection instead of the one that failed NOOP")
+	}
+	if _, stillTracked := p.lastUsed[unhealthy]; stillTracked {
+		t.Error("healthCheckIdle() left the discarded connection in lastUsed")
+	}
+	if p.numOpen != 1 {
+		t.Errorf("p.numOpen = %d, want 1 after discarding the unhealthy connection", p.numOpen)
+	}
+}
+
+func TestPoolPutCloseConcurrentNoPanic(t *testing.T) {
+	const n = 8
+	p := NewPool(func() (*FtpClient, error) {
+		return newPoolTestClient(t, healthyReplies()), nil
+	}, WithMaxConns(n))
+
+	clients := make([]*FtpClient, n)
+	for i := range clients {
+		client, err := p.Get(context.Background())
+		if err != nil {
+			t.Fatalf("Get(): %v", err)
+		}
+		clients[i] = client
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(n + 1)
+	for _, client := range clients {
+		client := client
+		go func() {
+			defer wg.Done()
+			p.Put(client)
+		}()
+	}
+	go func() {
+		defer wg.Done()
+		p.Close()
+	}()
+	wg.Wait()
+}
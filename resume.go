@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// restartAt issues REST to seek the next transfer to offset, so it can be
+// resumed rather than starting over from byte 0.
+func (c *FtpClient) restartAt(offset uint64) error {
+	command := fmt.Sprintf("REST %d", offset)
+	_, _, err := c.expectResponse(command, statusFileActionPending)
+	return err
+}
+
+// RetrieveFrom resumes downloading a remote file starting at offset,
+// streaming it rather than buffering the whole file in memory.  The
+// caller must Close the returned io.ReadCloser.
+func (c *FtpClient) RetrieveFrom(filename string, offset uint64) (io.ReadCloser, error) {
+	command := fmt.Sprintf("RETR %s", filename)
+	conn, err := c.openDataConnForCommand(command, offset)
+	if err != nil {
+		return nil, err
+	}
+	return &dataConnReader{conn: conn, client: c}, nil
+}
+
+// StoreFrom resumes uploading r to name starting at offset, streaming it
+// over the data connection.
+func (c *FtpClient) StoreFrom(name string, offset uint64, r io.Reader) error {
+	command := fmt.Sprintf("STOR %s", name)
+	conn, err := c.openDataConnForCommand(command, offset)
+	if err != nil {
+		return err
+	}
+	return c.writeDataConn(conn, r)
+}
+
+// Append sends the contents of r to be appended to an existing remote
+// file, using APPE, streaming it over the data connection.
+func (c *FtpClient) Append(name string, r io.Reader) error {
+	command := fmt.Sprintf("APPE %s", name)
+	conn, err := c.openDataConnForCommand(command, 0)
+	if err != nil {
+		return err
+	}
+	return c.writeDataConn(conn, r)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestRetrieveFromSurfacesRestError(t *testing.T) {
+	client, server := newTestClient(t)
+	ln := newFakeDataListener(t)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- func() error {
+			if err := server.expectCommand("PASV"); err != nil {
+				return err
+			}
+			if err := server.reply(statusEnterPassiveMode, pasvReplyFor(t, ln)); err != nil {
+				return err
+			}
+
+			conn, err := ln.Accept()
+			if err != nil {
+				return fmt.Errorf("accepting data connection: %w", err)
+			}
+			defer conn.Close()
+
+			if err := server.expectCommand("REST 1024"); err != nil {
+				return err
+			}
+			// The server doesn't support resuming; RetrieveFrom must not
+			// go on to send RETR as though nothing happened.
+			return server.reply(statusCommandNotImplemented, "REST not supported")
+		}()
+	}()
+
+	_, err := client.RetrieveFrom("big.bin", 1024)
+	if err == nil {
+		t.Fatal("RetrieveFrom() = nil error, want an error for a refused REST")
+	}
+
+	if err := <-errc; err != nil {
+		t.Fatalf("fake server: %v", err)
+	}
+}
+
+func TestRetrieveFromSendsRestThenRetr(t *testing.T) {
+	client, server := newTestClient(t)
+	ln := newFakeDataListener(t)
+
+	const want = "resumed contents"
+	errc := make(chan error, 1)
+	go func() {
+		errc <- func() error {
+			if err := server.expectCommand("PASV"); err != nil {
+				return err
+			}
+			if err := server.reply(statusEnterPassiveMode, pasvReplyFor(t, ln)); err != nil {
+				return err
+			}
+
+			conn, err := ln.Accept()
+			if err != nil {
+				return fmt.Errorf("accepting data connection: %w", err)
+			}
+			defer conn.Close()
+
+			if err := server.expectCommand("REST 1024"); err != nil {
+				return err
+			}
+			if err := server.reply(statusFileActionPending, "Ready for RETR"); err != nil {
+				return err
+			}
+
+			if err := server.expectCommand("RETR big.bin"); err != nil {
+				return err
+			}
+			if err := server.reply(statusEnterPassiveMode, "Opening data connection"); err != nil {
+				return err
+			}
+
+			if _, err := conn.Write([]byte(want)); err != nil {
+				return fmt.Errorf("writing file contents: %w", err)
+			}
+			conn.Close()
+
+			return server.reply(statusTransferComplete, "Transfer complete")
+		}()
+	}()
+
+	r, err := client.RetrieveFrom("big.bin", 1024)
+	if err != nil {
+		t.Fatalf("RetrieveFrom() = %v, want nil", err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading retrieved contents: %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("retrieved contents = %q, want %q", got, want)
+	}
+	// Close reads the final transfer-complete response off the control
+	// connection, which the fake server is waiting to send.
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close() = %v, want nil", err)
+	}
+
+	if err := <-errc; err != nil {
+		t.Fatalf("fake server: %v", err)
+	}
+}
+
+func TestStoreFromSurfacesRestError(t *testing.T) {
+	client, server := newTestClient(t)
+	ln := newFakeDataListener(t)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- func() error {
+			if err := server.expectCommand("PASV"); err != nil {
+				return err
+			}
+			if err := server.reply(statusEnterPassiveMode, pasvReplyFor(t, ln)); err != nil {
+				return err
+			}
+
+			conn, err := ln.Accept()
+			if err != nil {
+				return fmt.Errorf("accepting data connection: %w", err)
+			}
+			defer conn.Close()
+
+			if err := server.expectCommand("REST 512"); err != nil {
+				return err
+			}
+			return server.reply(statusCommandNotImplemented, "REST not supported")
+		}()
+	}()
+
+	err := client.StoreFrom("big.bin", 512, strings.NewReader("tail contents"))
+	if err == nil {
+		t.Fatal("StoreFrom() = nil, want an error for a refused REST")
+	}
+
+	if err := <-errc; err != nil {
+		t.Fatalf("fake server: %v", err)
+	}
+}
+
+func TestAppendSurfacesTransferError(t *testing.T) {
+	client, server := newTestClient(t)
+	ln := newFakeDataListener(t)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- func() error {
+			if err := server.expectCommand("PASV"); err != nil {
+				return err
+			}
+			if err := server.reply(statusEnterPassiveMode, pasvReplyFor(t, ln)); err != nil {
+				return err
+			}
+
+			conn, err := ln.Accept()
+			if err != nil {
+				return fmt.Errorf("accepting data connection: %w", err)
+			}
+			defer conn.Close()
+
+			if err := server.expectCommand("APPE log.txt"); err != nil {
+				return err
+			}
+			return server.reply(550, "Permission denied")
+		}()
+	}()
+
+	err := client.Append("log.txt", strings.NewReader("more log lines"))
+	if err == nil {
+		t.Fatal("Append() = nil, want an error for a refused APPE")
+	}
+
+	if err := <-errc; err != nil {
+		t.Fatalf("fake server: %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/textproto"
+)
+
+// WithTLS enables implicit FTPS: the control connection is wrapped in TLS
+// using cfg before the server's initial banner is ever read.  Implicit
+// FTPS servers conventionally listen on a dedicated port (e.g. 990).
+func WithTLS(cfg *tls.Config) DialOption {
+	return func(c *FtpClient) {
+		c.tlsConfig = cfg
+		c.implicitTLS = true
+	}
+}
+
+// WithExplicitTLS enables explicit FTPS: the client connects in the clear,
+// reads the banner, then sends AUTH TLS to upgrade the control connection
+// in place, followed by PBSZ 0 and PROT P so the data connection
+// negotiated for each transfer is TLS-protected too.
+func WithExplicitTLS(cfg *tls.Config) DialOption {
+	return func(c *FtpClient) {
+		c.tlsConfig = cfg
+		c.explicitTLS = true
+	}
+}
+
+// authTLS performs the explicit FTPS handshake: AUTH TLS, upgrading the
+// control connection, then PBSZ 0 and PROT P.
+func (c *FtpClient) authTLS() error {
+	if _, _, err := c.expectResponse("AUTH TLS", statusAuthOk); err != nil {
+		return err
+	}
+
+	tlsConn := tls.Client(c.conn, c.tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	c.conn = tlsConn
+	c.connection = textproto.NewConn(tlsConn)
+
+	if _, _, err := c.expectResponse("PBSZ 0", statusSuccess); err != nil {
+		return err
+	}
+	if _, _, err := c.expectResponse("PROT P", statusSuccess); err != nil {
+		return err
+	}
+	c.dataProtected = true
+
+	return nil
+}
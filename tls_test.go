@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// generateTestCert creates a throwaway self-signed certificate so tests can
+// exercise a real TLS handshake without any files on disk.
+func generateTestCert(t *testing.T) tls.Certificate {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating test key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ftpclient-test"},
+		NotBefore:    time.Unix(0, 0),
+		NotAfter:     time.Unix(0, 0).AddDate(100, 0, 0),
+		KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating test certificate: %v", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("building tls.Certificate: %v", err)
+	}
+	return cert
+}
+
+func TestAuthTLSSucceedsOnAcceptedHandshake(t *testing.T) {
+	client, server := newTestClient(t)
+	cert := generateTestCert(t)
+	client.tlsConfig = &tls.Config{InsecureSkipVerify: true}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- func() error {
+			if err := server.expectCommand("AUTH TLS"); err != nil {
+				return err
+			}
+			if err := server.reply(statusAuthOk, "AUTH TLS successful"); err != nil {
+				return err
+			}
+
+			tlsServer := tls.Server(server.netConn, &tls.Config{Certificates: []tls.Certificate{cert}})
+			if err := tlsServer.Handshake(); err != nil {
+				return fmt.Errorf("server handshake: %w", err)
+			}
+			server.upgrade(tlsServer)
+
+			if err := server.expectCommand("PBSZ 0"); err != nil {
+				return err
+			}
+			if err := server.reply(statusSuccess, "PBSZ ok"); err != nil {
+				return err
+			}
+			if err := server.expectCommand("PROT P"); err != nil {
+				return err
+			}
+			return server.reply(statusSuccess, "PROT ok")
+		}()
+	}()
+
+	if err := client.authTLS(); err != nil {
+		t.Fatalf("authTLS() = %v, want nil", err)
+	}
+	if !client.dataProtected {
+		t.Error("authTLS() left dataProtected false after a successful handshake")
+	}
+	if _, ok := client.conn.(*tls.Conn); !ok {
+		t.Errorf("authTLS() left client.conn as %T, want *tls.Conn", client.conn)
+	}
+
+	if err := <-errc; err != nil {
+		t.Fatalf("fake server: %v", err)
+	}
+}
+
+func TestAuthTLSFailsWithoutHandshakeWhenRejected(t *testing.T) {
+	client, server := newTestClient(t)
+	client.tlsConfig = &tls.Config{InsecureSkipVerify: true}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- func() error {
+			if err := server.expectCommand("AUTH TLS"); err != nil {
+				return err
+			}
+			// The server doesn't support AUTH TLS; authTLS must stop here
+			// instead of attempting a handshake the server never agreed to.
+			return server.reply(statusCommandNotImplemented, "Command not implemented")
+		}()
+	}()
+
+	err := client.authTLS()
+	if err == nil {
+		t.Fatal("authTLS() = nil, want an error when AUTH TLS is rejected")
+	}
+	if client.dataProtected {
+		t.Error("authTLS() set dataProtected true despite a rejected AUTH TLS")
+	}
+	if _, ok := client.conn.(*tls.Conn); ok {
+		t.Error("authTLS() wrapped client.conn in TLS despite a rejected AUTH TLS")
+	}
+
+	if err := <-errc; err != nil {
+		t.Fatalf("fake server: %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import "strings"
+
+// Walk recursively descends the remote directory tree rooted at root,
+// calling fn once for every entry it encounters, in the style of
+// filepath.Walk's WalkFunc.  If fn returns an error, Walk stops and
+// returns that error immediately.
+func (c *FtpClient) Walk(root string, fn func(path string, entry *Entry, err error) error) error {
+	entries, err := c.NameList(root)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+
+	for _, entry := range entries {
+		// cdir/pdir mark the listed directory and its parent; they aren't
+		// children to recurse into.  LIST-fallback parsing (servers with no
+		// MLSD support) has no equivalent facts and returns "." and ".." as
+		// ordinary directory entries instead, so filter those by name too -
+		// otherwise Walk recurses into them forever.
+		if entry.Type == EntryTypeCDir || entry.Type == EntryTypePDir {
+			continue
+		}
+		if entry.Name == "." || entry.Name == ".." {
+			continue
+		}
+
+		path := joinRemotePath(root, entry.Name)
+
+		if err := fn(path, entry, nil); err != nil {
+			return err
+		}
+
+		if entry.Type == EntryTypeDir {
+			if err := c.Walk(path, fn); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// joinRemotePath joins a remote directory and entry name with "/", the
+// path separator FTP servers use regardless of host OS.
+func joinRemotePath(dir, name string) string {
+	if dir == "" {
+		return name
+	}
+	return strings.TrimRight(dir, "/") + "/" + name
+}